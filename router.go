@@ -10,22 +10,98 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"unicode"
 
-	"github.com/robfig/pathtree"
 	"gopkg.in/v1/yaml"
 )
 
 type Route struct {
-	Method         string   // e.g. GET
-	Path           string   // e.g. /app/:id
-	Action         string   // e.g. "Application.ShowApp", "404"
-	ControllerName string   // e.g. "Application", ""
-	MethodName     string   // e.g. "ShowApp", ""
-	FixedParams    []string // e.g. "arg1","arg2","arg3" (CSV formatting)
-	TreePath       string   // e.g. "/GET/app/:id"
+	Method          string   // e.g. GET
+	Path            string   // e.g. /app/:id
+	Action          string   // e.g. "Application.ShowApp", "404"
+	ControllerName  string   // e.g. "Application", ""
+	MethodName      string   // e.g. "ShowApp", ""
+	FixedParams     []string // e.g. "arg1","arg2","arg3" (CSV formatting)
+	MiddlewareNames []string // e.g. "Auth","Logging"
+	Host            string   // e.g. "{sub}.example.com", ""
+	Scheme          string   // e.g. "https", ""
+
+	// AutoArgNames holds the reflected argument names of the action this
+	// route was synthesized for, in order, when the route comes from an
+	// "auto:" directive rather than an explicit routes.yml entry. When the
+	// action takes arguments, such a route's Path ends in "*params" and its
+	// single catch-all capture is re-split on "/" and bound positionally to
+	// these names instead of being exposed as one opaque "params" value; a
+	// zero-arg action's route has a bare path and an empty, non-nil slice.
+	// Nil for ordinary routes.
+	AutoArgNames []string
 
 	routesPath string // e.g. /Users/robfig/gocode/src/myapp/conf/routes
 	line       int    // e.g. 3
+
+	// hostPattern/pathPattern match Host/Path outside of the path tree, for
+	// routes constrained by Host or Scheme (see Router.routeVhost).
+	hostPattern     *regexp.Regexp
+	hostWildcards   []string
+	pathPattern     *regexp.Regexp
+	pathWildcards   []string
+	pathConstraints []*regexp.Regexp // parallel to pathWildcards; nil entries are unconstrained
+}
+
+// compileVhostMatchers builds the regexps used to match this route's Host
+// and Path outside the path tree. Only called for routes with a Host or
+// Scheme constraint.
+func (route *Route) compileVhostMatchers() {
+	if route.Host != "" {
+		route.hostPattern, route.hostWildcards = compileHostPattern(route.Host)
+	}
+	route.pathPattern, route.pathWildcards, route.pathConstraints = compilePathPattern(route.Path)
+}
+
+var hostWildcardPattern = regexp.MustCompile(`\{(\w+)\}`)
+
+// compileHostPattern turns a host spec such as "{sub}.example.com" into a
+// regexp with one capture group per {wildcard}, plus the ordered list of
+// wildcard names.
+func compileHostPattern(host string) (*regexp.Regexp, []string) {
+	var names []string
+	quoted := regexp.QuoteMeta(host)
+	quoted = strings.NewReplacer(`\{`, "{", `\}`, "}").Replace(quoted)
+	pattern := hostWildcardPattern.ReplaceAllStringFunc(quoted, func(m string) string {
+		names = append(names, hostWildcardPattern.FindStringSubmatch(m)[1])
+		return "([^.]+)"
+	})
+	return regexp.MustCompile("^" + pattern + "$"), names
+}
+
+// compilePathPattern mirrors the route tree's own ":name", "{name[:type]}",
+// and "*name" segment syntax, but as a regexp, so vhost routes can be
+// matched without going through the (host-unaware) path tree. The returned
+// constraints are parallel to names; a typed parameter whose value fails
+// its constraint must be rejected by the caller rather than treated as a
+// match (see Router.routeVhost).
+func compilePathPattern(p string) (*regexp.Regexp, []string, []*regexp.Regexp) {
+	var (
+		names       []string
+		constraints []*regexp.Regexp
+	)
+	segments := strings.Split(p, "/")
+	for i, seg := range segments {
+		kind, name, typ, constraintSrc := parsePathSegment(seg)
+		switch kind {
+		case segParam:
+			names = append(names, name)
+			constraints = append(constraints, constraintFor(typ, constraintSrc))
+			segments[i] = `([^/]+)`
+		case segCatchAll:
+			names = append(names, name)
+			constraints = append(constraints, nil)
+			segments[i] = `(.*)`
+		default:
+			segments[i] = regexp.QuoteMeta(seg)
+		}
+	}
+	return regexp.MustCompile("^" + strings.Join(segments, "/") + "$"), names, constraints
 }
 
 type RouteMatch struct {
@@ -34,6 +110,9 @@ type RouteMatch struct {
 	MethodName     string // e.g. ShowApp
 	FixedParams    []string
 	Params         map[string][]string // e.g. {id: 123}
+	Middleware     []Middleware        // resolved chain: global, then group, then route
+	Path           string              // canonical path to redirect to, when Action == "redirect"
+	AllowedMethods []string            // methods the path does support, when Action == "405" or "options"
 }
 
 type arg struct {
@@ -42,6 +121,24 @@ type arg struct {
 	constraint *regexp.Regexp
 }
 
+// Middleware wraps an http.Handler to provide cross-cutting request
+// processing -- auth, CORS, rate-limiting, tracing, and the like -- around
+// the normal Revel filter chain and action invocation. It follows the same
+// signature used by chi and gorilla/mux so existing net/http middleware can
+// be registered directly.
+type Middleware func(http.Handler) http.Handler
+
+// middlewareRegistry holds middleware registered by name so routes.yml can
+// reference it from "middleware:", "use:", and "group:" entries.
+var middlewareRegistry = make(map[string]Middleware)
+
+// RegisterMiddleware makes mw available under name for reference from
+// routes.yml. Typically called from an app's init() alongside any
+// RegisterController calls.
+func RegisterMiddleware(name string, mw Middleware) {
+	middlewareRegistry[name] = mw
+}
+
 // Prepares the route to be used in matching.
 func NewRoute(method, path, action, routesPath string, fixedArgs []string) (r *Route) {
 	r = &Route{
@@ -49,7 +146,6 @@ func NewRoute(method, path, action, routesPath string, fixedArgs []string) (r *R
 		Path:        path,
 		Action:      action,
 		FixedParams: fixedArgs,
-		TreePath:    treePath(strings.ToUpper(method), path),
 		routesPath:  routesPath,
 		line:        0,
 	}
@@ -69,35 +165,120 @@ func NewRoute(method, path, action, routesPath string, fixedArgs []string) (r *R
 	return
 }
 
-func treePath(method, path string) string {
-	if method == "*" {
-		method = ":METHOD"
-	}
-	return "/" + method + path
-}
-
 type Router struct {
 	Routes []*Route
-	Tree   *pathtree.Node
+	Tree   *routeNode
 	path   string // path to the routes file
+
+	globalMiddleware []Middleware // registered via Router.Use
+	yamlMiddleware   []Middleware // registered via "- use: [...]" in routes.yml; recomputed on Refresh
+
+	vhostRoutes []*Route // routes constrained by Host and/or Scheme, matched outside the path tree
+}
+
+// Use appends middleware to the global stack, which runs -- in the order
+// added -- around every route in addition to any group- or route-specific
+// middleware. Unlike the middleware named in routes.yml, this is not reset
+// by Refresh, so it is the natural place for middleware configured in Go
+// code (e.g. from an app's init()).
+func (router *Router) Use(mw ...Middleware) {
+	router.globalMiddleware = append(router.globalMiddleware, mw...)
+}
+
+// resolveMiddleware builds the full chain for a route: globally registered
+// middleware (Go and YAML), followed by the route's own named middleware
+// (which includes anything inherited from an enclosing group).
+func (router *Router) resolveMiddleware(route *Route) []Middleware {
+	total := len(router.globalMiddleware) + len(router.yamlMiddleware) + len(route.MiddlewareNames)
+	if total == 0 {
+		return nil
+	}
+	chain := make([]Middleware, 0, total)
+	chain = append(chain, router.globalMiddleware...)
+	chain = append(chain, router.yamlMiddleware...)
+	for _, name := range route.MiddlewareNames {
+		// validateRoute already rejected an unregistered name at Refresh
+		// time, so this can't actually miss for a route in router.Routes;
+		// the lookup stays a lookup (rather than an index into a
+		// pre-resolved slice) only because MiddlewareNames is still plain
+		// strings on Route.
+		mw, ok := middlewareRegistry[name]
+		if !ok {
+			WARN.Println("revel/router: unknown middleware", name, "referenced by", route.Path)
+			continue
+		}
+		chain = append(chain, mw)
+	}
+	return chain
 }
 
 var notFound = &RouteMatch{Action: "404"}
 
+// methodNotAllowed builds the RouteMatch for a path that matched but not for
+// the request's method: a 405, with allowed carried along for the Allow
+// header. Unlike notFound this can't be a plain sentinel value, since
+// allowed varies per path.
+func methodNotAllowed(allowed []string) *RouteMatch {
+	return &RouteMatch{Action: "405", AllowedMethods: allowed}
+}
+
+// effectiveMethod returns the HTTP method to route req by: ordinarily just
+// req.Method, but overridable -- when "router.methodoverride" is enabled --
+// by an X-HTTP-Method-Override header or "_method" form field, for clients
+// (notably HTML forms) that can't issue arbitrary methods directly.
+func effectiveMethod(req *http.Request) string {
+	if !Config.BoolDefault("router.methodoverride", false) {
+		return req.Method
+	}
+	if override := req.Header.Get("X-HTTP-Method-Override"); override != "" {
+		return strings.ToUpper(override)
+	}
+	if override := req.FormValue("_method"); override != "" {
+		return strings.ToUpper(override)
+	}
+	return req.Method
+}
+
+// cleanPath returns the canonical form of p: collapsed "//" and resolved
+// "." and ".." segments, always starting with "/" and preserving a
+// trailing slash (since routes often distinguish "/foo" from "/foo/").
+func cleanPath(p string) string {
+	if p == "" {
+		return "/"
+	}
+	if p[0] != '/' {
+		p = "/" + p
+	}
+	np := path.Clean(p)
+	if np != "/" && strings.HasSuffix(p, "/") {
+		np += "/"
+	}
+	return np
+}
+
 func (router *Router) Route(req *http.Request) *RouteMatch {
-	leaf, expansions := router.Tree.Find(treePath(req.Method, req.URL.Path))
+	if match := router.routeVhost(req); match != nil {
+		return match
+	}
+
+	reqPath := req.URL.Path
+	if clean := cleanPath(reqPath); clean != reqPath && Config.BoolDefault("router.cleanpath", true) {
+		return &RouteMatch{Action: "redirect", Path: clean}
+	}
+
+	leaf, params := router.Tree.Find(reqPath)
 	if leaf == nil {
 		return nil
 	}
-	route := leaf.Value.(*Route)
 
-	// Create a map of the route parameters.
-	var params url.Values
-	if len(expansions) > 0 {
-		params = make(url.Values)
-		for i, v := range expansions {
-			params[leaf.Wildcards[i]] = []string{v}
+	method := effectiveMethod(req)
+	route, ok := leaf.resolve(method)
+	if !ok {
+		allowed := leaf.allowedMethods()
+		if method == "OPTIONS" {
+			return &RouteMatch{Action: "options", AllowedMethods: allowed}
 		}
+		return methodNotAllowed(allowed)
 	}
 
 	// Special handling for explicit 404's.
@@ -114,48 +295,218 @@ func (router *Router) Route(req *http.Request) *RouteMatch {
 		methodName = params[methodName[1:]][0]
 	}
 
+	if len(route.AutoArgNames) > 0 {
+		params = autoParams(route.AutoArgNames, params)
+	}
+
 	return &RouteMatch{
 		ControllerName: controllerName,
 		MethodName:     methodName,
 		Params:         params,
 		FixedParams:    route.FixedParams,
+		Middleware:     router.resolveMiddleware(route),
+	}
+}
+
+// autoParams re-splits an auto-routed action's single "*params" catch-all
+// capture on "/" and binds the resulting segments positionally to the
+// action's reflected argument names.
+func autoParams(argNames []string, params url.Values) url.Values {
+	raw := ""
+	if len(params["params"]) > 0 {
+		raw = params["params"][0]
+	}
+	delete(params, "params")
+	if raw == "" {
+		return params
+	}
+	for i, seg := range strings.Split(raw, "/") {
+		if i >= len(argNames) {
+			break
+		}
+		params[argNames[i]] = []string{seg}
+	}
+	return params
+}
+
+// routeVhost checks the vhost-constrained routes (those with a "host:" or
+// "scheme:" restriction) against the request's Host header and inferred
+// scheme, since the path tree has no notion of either. Candidates are
+// matched on host and path alone (method is resolved afterwards via the
+// same routeLeaf machinery as the tree-backed path, so a matching host/path
+// with the wrong method gets a proper 405/OPTIONS); a host+path match on
+// the wrong scheme is kept aside as a canonical-scheme redirect in case no
+// route accepts this request's scheme at all.
+func (router *Router) routeVhost(req *http.Request) *RouteMatch {
+	if len(router.vhostRoutes) == 0 {
+		return nil
+	}
+
+	scheme := requestScheme(req)
+	host := req.Host
+	if i := strings.IndexByte(host, ':'); i >= 0 {
+		host = host[:i]
+	}
+
+	var (
+		candidates    []*Route
+		paramsByRoute = make(map[*Route]url.Values)
+		schemeMiss    *Route
+	)
+
+	for _, route := range router.vhostRoutes {
+		params := make(url.Values)
+		if route.hostPattern != nil {
+			m := route.hostPattern.FindStringSubmatch(host)
+			if m == nil {
+				continue
+			}
+			for i, name := range route.hostWildcards {
+				params[name] = []string{m[i+1]}
+			}
+		}
+
+		m := route.pathPattern.FindStringSubmatch(req.URL.Path)
+		if m == nil {
+			continue
+		}
+		rejected := false
+		for i, name := range route.pathWildcards {
+			val := m[i+1]
+			if c := route.pathConstraints[i]; c != nil && !c.MatchString(val) {
+				rejected = true
+				break
+			}
+			params[name] = []string{val}
+		}
+		if rejected {
+			continue
+		}
+
+		if route.Scheme != "" && route.Scheme != scheme {
+			if schemeMiss == nil {
+				schemeMiss = route
+			}
+			continue
+		}
+
+		candidates = append(candidates, route)
+		paramsByRoute[route] = params
+	}
+
+	if len(candidates) == 0 {
+		if schemeMiss != nil {
+			return &RouteMatch{Action: "redirect", Path: canonicalSchemeURL(schemeMiss.Scheme, req)}
+		}
+		return nil
+	}
+
+	method := effectiveMethod(req)
+	leaf := newRouteLeaf(candidates...)
+	route, ok := leaf.resolve(method)
+	if !ok {
+		allowed := leaf.allowedMethods()
+		if method == "OPTIONS" {
+			return &RouteMatch{Action: "options", AllowedMethods: allowed}
+		}
+		return methodNotAllowed(allowed)
+	}
+
+	if route.Action == "404" {
+		return notFound
+	}
+
+	params := paramsByRoute[route]
+	controllerName, methodName := route.ControllerName, route.MethodName
+	if controllerName[0] == ':' {
+		controllerName = params[controllerName[1:]][0]
+	}
+	if methodName[0] == ':' {
+		methodName = params[methodName[1:]][0]
+	}
+
+	return &RouteMatch{
+		ControllerName: controllerName,
+		MethodName:     methodName,
+		Params:         params,
+		FixedParams:    route.FixedParams,
+		Middleware:     router.resolveMiddleware(route),
+	}
+}
+
+// requestScheme returns "https" or "http" for req, honoring a TLS
+// termination proxy's X-Forwarded-Proto header.
+func requestScheme(req *http.Request) string {
+	if req.TLS != nil {
+		return "https"
+	}
+	if proto := req.Header.Get("X-Forwarded-Proto"); proto != "" {
+		return strings.ToLower(proto)
 	}
+	return "http"
+}
+
+// canonicalSchemeURL rebuilds req's URL under scheme, for redirecting a
+// request that reached a scheme-constrained route over the wrong scheme.
+func canonicalSchemeURL(scheme string, req *http.Request) string {
+	return scheme + "://" + req.Host + req.URL.RequestURI()
 }
 
 // Refresh re-reads the routes file and re-calculates the routing table.
 // Returns an error if a specified action could not be found.
 func (router *Router) Refresh() (err *Error) {
-	router.Routes, err = parseRoutesFile(router.path, "", true)
+	var globalUse, autoNames []string
+	router.Routes, globalUse, autoNames, err = parseRoutesFile(router.path, "", true)
 	if err != nil {
 		return
 	}
+
+	router.yamlMiddleware = nil
+	for _, name := range globalUse {
+		mw, ok := middlewareRegistry[name]
+		if !ok {
+			// parseRouteEntries already rejects an unknown "use:" name when
+			// validate is true, as it always is here; this is a backstop.
+			return routeError(fmt.Errorf("unknown middleware %q referenced by \"use\"", name), router.path, "", 0)
+		}
+		router.yamlMiddleware = append(router.yamlMiddleware, mw)
+	}
+
+	router.Routes = append(router.Routes, synthesizeAutoRoutes(autoNames)...)
+
 	err = router.updateTree()
 	return
 }
 
 func (router *Router) updateTree() *Error {
-	router.Tree = pathtree.New()
+	router.Tree = newRouteTree()
+	router.vhostRoutes = nil
 	for _, route := range router.Routes {
-		err := router.Tree.Add(route.TreePath, route)
-
-		// Allow GETs to respond to HEAD requests.
-		if err == nil && route.Method == "GET" {
-			err = router.Tree.Add(treePath("HEAD", route.Path), route)
+		// Routes constrained by Host or Scheme are matched separately from
+		// the path tree, which has no notion of either.
+		if route.Host != "" || route.Scheme != "" {
+			route.compileVhostMatchers()
+			router.vhostRoutes = append(router.vhostRoutes, route)
+			continue
 		}
 
-		// Error adding a route to the pathtree.
-		if err != nil {
+		// Error adding a route to the route tree. (Unlike the method the
+		// route was registered for, HEAD is served implicitly from GET by
+		// routeLeaf.resolve, so there's nothing more to add here.)
+		if err := router.Tree.Add(route); err != nil {
 			return routeError(err, route.routesPath, "", 0)
 		}
 	}
 	return nil
 }
 
-// parseRoutesFile reads the given routes file and returns the contained routes.
-func parseRoutesFile(routesPath, joinedPath string, validate bool) ([]*Route, *Error) {
+// parseRoutesFile reads the given routes file and returns the contained
+// routes, along with the names of any globally-registered middleware
+// ("- use: [...]" entries) and any "- auto: [...]" controller names.
+func parseRoutesFile(routesPath, joinedPath string, validate bool) ([]*Route, []string, []string, *Error) {
 	contentBytes, err := ioutil.ReadFile(routesPath)
 	if err != nil {
-		return nil, &Error{
+		return nil, nil, nil, &Error{
 			Title:       "Failed to load routes file",
 			Description: err.Error(),
 		}
@@ -177,16 +528,29 @@ func lineFromYamlError(err error) int {
 
 // parseRoutes reads the content of a routes file into the routing table.
 // joinedPath is the recursively passed in prefix for routes.
-func parseRoutes(routesPath, joinedPath, content string, validate bool) ([]*Route, *Error) {
-	var (
-		routes     []*Route
-		parsedYaml []map[string]interface{}
-	)
+func parseRoutes(routesPath, joinedPath, content string, validate bool) ([]*Route, []string, []string, *Error) {
+	var parsedYaml []map[string]interface{}
 
 	if err := yaml.Unmarshal([]byte(content), &parsedYaml); err != nil {
-		return nil, routeError(err, routesPath, content, lineFromYamlError(err))
+		return nil, nil, nil, routeError(err, routesPath, content, lineFromYamlError(err))
 	}
 
+	return parseRouteEntries(routesPath, joinedPath, content, parsedYaml, nil, validate)
+}
+
+// parseRouteEntries walks a parsed YAML route list, expanding "import",
+// "use", "group", and "auto" entries and appending any groupMiddleware
+// (inherited from an enclosing "- group:" block) onto every concrete route
+// it produces. The returned autoNames are the controller names (or "*")
+// named by any "- auto: ..." entries, for the caller to synthesize routes
+// from once the controller registry is fully populated.
+func parseRouteEntries(routesPath, joinedPath, content string, parsedYaml []map[string]interface{}, groupMiddleware []string, validate bool) ([]*Route, []string, []string, *Error) {
+	var (
+		routes    []*Route
+		globalUse []string
+		autoNames []string
+	)
+
 	for _, route := range parsedYaml {
 		if route == nil {
 			continue
@@ -207,58 +571,245 @@ func parseRoutes(routesPath, joinedPath, content string, validate bool) ([]*Rout
 			}
 			modulePrefix := strings.Join([]string{joinedPath, prefix}, "")
 
-			moduleRoutes, err := getModuleRoutes(moduleName, modulePrefix, validate)
+			moduleRoutes, moduleUse, moduleAuto, err := getModuleRoutes(moduleName, modulePrefix, validate)
 			if err != nil {
-				return nil, routeError(err, routesPath, content, lineFromYamlError(err))
+				return nil, nil, nil, routeError(err, routesPath, content, lineFromYamlError(err))
 			}
 
 			routes = append(routes, moduleRoutes...)
-		} else {
-			// This should be a valid route of format:
-			//	- method: (GET|POST|PUT|DELETE|PATCH|OPTIONS|HEAD|WS|\\*)
-			//	- path: /example/path
-			//	- action: <Controller>.<Action>
-			//	- params: ["first", "second"]
-
-			// Verify all of the required keys are present. "params" is optional
-			for _, key := range requiredRouteOptions {
-				if _, ok := route[key]; !ok {
-					return nil, routeError(errors.New(fmt.Sprintf("Missing required route option \"%s\"", key)), routesPath, content, 0)
+			globalUse = append(globalUse, moduleUse...)
+			autoNames = append(autoNames, moduleAuto...)
+			continue
+		}
+
+		// A top-level "- use: [Auth, Logging]" entry registers middleware
+		// that applies to every route in the application.
+		if names, ok := route["use"]; ok {
+			useNames, err := stringList(names)
+			if err != nil {
+				return nil, nil, nil, routeError(fmt.Errorf("invalid \"use\" entry: %s", err), routesPath, content, 0)
+			}
+			if validate {
+				for _, name := range useNames {
+					if _, ok := middlewareRegistry[name]; !ok {
+						return nil, nil, nil, routeError(fmt.Errorf("unknown middleware %q referenced by \"use\"", name), routesPath, content, 0)
+					}
 				}
 			}
+			globalUse = append(globalUse, useNames...)
+			continue
+		}
 
-			// this will be nil if there are no params, but this needs to be a string slice
-			var params []string
-			_, ok := route["params"]
-			if ok {
-				for _, val := range route["params"].([]interface{}) {
-					params = append(params, val.(string))
+		// A top-level "- auto: Application" (or "- auto: \"*\"") entry
+		// synthesizes routes for every exported action of the named
+		// controller (or, for "*", every registered controller) once the
+		// controller registry has been populated.
+		if name, ok := route["auto"].(string); ok {
+			autoNames = append(autoNames, name)
+			continue
+		}
+
+		// A "- group: /admin" entry with a nested "routes:" list applies its
+		// path prefix and middleware to every route (and sub-group) within it.
+		if groupPrefix, ok := route["group"].(string); ok {
+			nestedRaw, ok := route["routes"].([]interface{})
+			if !ok {
+				return nil, nil, nil, routeError(errors.New("\"group\" requires a nested \"routes\" list"), routesPath, content, 0)
+			}
+
+			groupMwNames, err := stringList(route["middleware"])
+			if err != nil {
+				return nil, nil, nil, routeError(fmt.Errorf("invalid \"middleware\" entry: %s", err), routesPath, content, 0)
+			}
+
+			nested := make([]map[string]interface{}, 0, len(nestedRaw))
+			for _, n := range nestedRaw {
+				switch m := n.(type) {
+				case map[string]interface{}:
+					nested = append(nested, m)
+				case map[interface{}]interface{}:
+					// Nested YAML mappings decode with interface{} keys.
+					sm := make(map[string]interface{}, len(m))
+					for k, v := range m {
+						if ks, ok := k.(string); ok {
+							sm[ks] = v
+						}
+					}
+					nested = append(nested, sm)
 				}
 			}
 
-			method := route["method"].(string)
-			if !routeMethodPattern.MatchString(method) {
-				return nil, routeError(errors.New(fmt.Sprintf("Unknown route method \"%s\"", method)), routesPath, content, 0)
+			groupRoutes, groupUse, groupAuto, err2 := parseRouteEntries(
+				routesPath, joinedPath, content, nested,
+				append(append([]string{}, groupMiddleware...), groupMwNames...),
+				validate)
+			if err2 != nil {
+				return nil, nil, nil, err2
 			}
-			path := route["path"].(string)
-			action := route["action"].(string)
+			for _, r := range groupRoutes {
+				r.Path = groupPrefix + r.Path
+			}
+			routes = append(routes, groupRoutes...)
+			globalUse = append(globalUse, groupUse...)
+			autoNames = append(autoNames, groupAuto...)
+			continue
+		}
 
-			route := NewRoute(method, path, action, routesPath, params)
-			routes = append(routes, route)
+		// This should be a valid route of format:
+		//	- method: (GET|POST|PUT|DELETE|PATCH|OPTIONS|HEAD|WS|\\*)
+		//	- path: /example/path
+		//	- action: <Controller>.<Action>
+		//	- params: ["first", "second"]
+		//	- middleware: ["Auth", "Logging"]
+		//	- host: "{sub}.example.com"
+		//	- scheme: https
+
+		// Verify all of the required keys are present. "params" is optional
+		for _, key := range requiredRouteOptions {
+			if _, ok := route[key]; !ok {
+				return nil, nil, nil, routeError(errors.New(fmt.Sprintf("Missing required route option \"%s\"", key)), routesPath, content, 0)
+			}
+		}
 
-			if validate {
-				if err := validateRoute(route); err != nil {
-					return nil, routeError(err, routesPath, content, 0)
-				}
+		// this will be nil if there are no params, but this needs to be a string slice
+		var params []string
+		_, ok := route["params"]
+		if ok {
+			for _, val := range route["params"].([]interface{}) {
+				params = append(params, val.(string))
+			}
+		}
+
+		method := route["method"].(string)
+		if !routeMethodPattern.MatchString(method) {
+			return nil, nil, nil, routeError(errors.New(fmt.Sprintf("Unknown route method \"%s\"", method)), routesPath, content, 0)
+		}
+		path := route["path"].(string)
+		action := route["action"].(string)
+
+		middlewareNames, err := stringList(route["middleware"])
+		if err != nil {
+			return nil, nil, nil, routeError(fmt.Errorf("invalid \"middleware\" entry: %s", err), routesPath, content, 0)
+		}
+
+		newRoute := NewRoute(method, path, action, routesPath, params)
+		newRoute.MiddlewareNames = append(append([]string{}, groupMiddleware...), middlewareNames...)
+		newRoute.Host, _ = route["host"].(string)
+		newRoute.Scheme, _ = route["scheme"].(string)
+		routes = append(routes, newRoute)
+
+		if validate {
+			if err := validateRoute(newRoute); err != nil {
+				return nil, nil, nil, routeError(err, routesPath, content, 0)
 			}
 		}
 	}
 
-	return routes, nil
+	return routes, globalUse, autoNames, nil
+}
+
+// stringList coerces a YAML value parsed as []interface{} of strings (e.g.
+// "middleware: [Auth, Logging]") into a []string. A nil value yields a nil
+// slice.
+func stringList(val interface{}) ([]string, error) {
+	if val == nil {
+		return nil, nil
+	}
+	raw, ok := val.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected a list, got %T", val)
+	}
+	list := make([]string, 0, len(raw))
+	for _, v := range raw {
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected a string, got %T", v)
+		}
+		list = append(list, s)
+	}
+	return list, nil
+}
+
+// autoMethodPrefixes is the set of action-name prefixes that imply an HTTP
+// method for an auto-routed action, checked in order. A prefix only counts
+// if it ends on a word boundary, so "GetStatus" matches "Get" but "Getty"
+// does not.
+var autoMethodPrefixes = []string{"Get", "Post", "Put", "Delete"}
+
+// autoHTTPMethod infers the HTTP method an auto-routed action responds to
+// from its name, falling back to "*" (any method) when no prefix matches.
+func autoHTTPMethod(name string) string {
+	for _, prefix := range autoMethodPrefixes {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		if len(name) == len(prefix) || unicode.IsUpper(rune(name[len(prefix)])) {
+			return strings.ToUpper(prefix)
+		}
+	}
+	return "*"
+}
+
+// synthesizeAutoRoutes builds the routes implied by the "- auto: ..."
+// directives named in routes.yml: one route per exported action of each
+// named controller (or, for "*", every controller registered via
+// RegisterController), of the form "/<controller>/<action>/*params".
+func synthesizeAutoRoutes(names []string) []*Route {
+	var routes []*Route
+	for _, name := range names {
+		if name == "*" {
+			for _, ct := range controllerRegistry {
+				routes = append(routes, autoRoutesForController(ct)...)
+			}
+			continue
+		}
+		ct, ok := controllerRegistry[name]
+		if !ok {
+			WARN.Println("revel/router: \"auto\" entry references unknown controller", name)
+			continue
+		}
+		routes = append(routes, autoRoutesForController(ct)...)
+	}
+	return routes
+}
+
+// autoRoutesForController synthesizes one route per exported action of ct.
+// A zero-arg action gets a bare "/<controller>/<action>" path rather than a
+// "*params" catch-all, so it's reachable at the URL you'd actually guess
+// instead of only at that URL plus a spurious trailing slash.
+func autoRoutesForController(ct *ControllerType) []*Route {
+	controllerName := ct.Type.Name()
+	routes := make([]*Route, 0, len(ct.Methods))
+	for _, m := range ct.Methods {
+		argNames := make([]string, len(m.Args))
+		for i, a := range m.Args {
+			argNames[i] = a.Name
+		}
+
+		path := "/" + strings.ToLower(controllerName) + "/" + strings.ToLower(m.Name)
+		if len(argNames) > 0 {
+			path += "/*params"
+		}
+
+		route := NewRoute(autoHTTPMethod(m.Name), path, controllerName+"."+m.Name, "", nil)
+		route.AutoArgNames = argNames
+		routes = append(routes, route)
+	}
+	return routes
 }
 
 // validateRoute checks that every specified action exists.
 func validateRoute(route *Route) error {
+	// Every named middleware (route-level "middleware:", and anything
+	// inherited from an enclosing "group:") must already be registered, so
+	// a typo like "Ath" for "Auth" fails Refresh instead of silently
+	// serving the route with that middleware missing from the chain.
+	for _, name := range route.MiddlewareNames {
+		if _, ok := middlewareRegistry[name]; !ok {
+			return fmt.Errorf("unknown middleware %q referenced by route %s", name, route.Path)
+		}
+	}
+
 	// Skip 404s
 	if route.Action == "404" {
 		return nil
@@ -309,28 +860,28 @@ func routeError(err error, routesPath, content string, line int) *Error {
 
 // getModuleRoutes loads the routes file for the given module and returns the
 // list of routes.
-func getModuleRoutes(moduleName, joinedPath string, validate bool) ([]*Route, *Error) {
+func getModuleRoutes(moduleName, joinedPath string, validate bool) ([]*Route, []string, []string, *Error) {
 	// Look up the module.  It may be not found due to the common case of e.g. the
 	// testrunner module being active only in dev mode.
 	module, found := ModuleByName(moduleName)
 	if !found {
 		INFO.Println("Skipping routes for inactive module", moduleName)
-		return nil, nil
+		return nil, nil, nil, nil
 	}
 	return parseRoutesFile(path.Join(module.Path, "conf", "routes.yml"), joinedPath, validate)
 }
 
 func NewRouter(routesPath string) *Router {
 	return &Router{
-		Tree: pathtree.New(),
+		Tree: newRouteTree(),
 		path: routesPath,
 	}
 }
 
 type ActionDefinition struct {
-	Host, Method, Url, Action string
-	Star                      bool
-	Args                      map[string]string
+	Host, Method, Url, Action, Scheme string
+	Star                              bool
+	Args                              map[string]string
 }
 
 func (a *ActionDefinition) String() string {
@@ -345,6 +896,7 @@ func (router *Router) Reverse(action string, argValues map[string]string) *Actio
 	}
 	controllerName, methodName := actionSplit[0], actionSplit[1]
 
+routes:
 	for _, route := range router.Routes {
 		// Skip routes without either a ControllerName or MethodName
 		if route.ControllerName == "" || route.MethodName == "" {
@@ -365,25 +917,73 @@ func (router *Router) Reverse(action string, argValues map[string]string) *Actio
 			argValues[route.MethodName[1:]] = methodName
 		}
 
+		// Args used in the Host or Path are removed from argValues only once
+		// this route is chosen, so a route skipped below for a failed
+		// constraint leaves them in place for the next one.
+		var consumed []string
+
+		// Substitute any {wildcard} segments of a constrained Host.
+		host := route.Host
+		for _, name := range route.hostWildcards {
+			val, ok := argValues[name]
+			if !ok {
+				val = "<nil>"
+				ERROR.Print("revel/router: reverse route missing host arg ", name)
+			}
+			host = strings.Replace(host, "{"+name+"}", val, 1)
+			consumed = append(consumed, name)
+		}
+
 		// Build up the URL.
 		var (
 			queryValues  = make(url.Values)
 			pathElements = strings.Split(route.Path, "/")
 		)
 		for i, el := range pathElements {
-			if el == "" || el[0] != ':' {
+			kind, name, typ, constraintSrc := parsePathSegment(el)
+			if kind == segStatic {
 				continue
 			}
 
-			val, ok := argValues[el[1:]]
+			// An auto-routed action's "*params" catch-all is reversed by
+			// joining the values of its reflected arg names back into one
+			// path segment, rather than looking up a literal "params" value.
+			// Only an auto-routed action with arguments has this catch-all;
+			// a zero-arg action's bare path has no segment to fill here.
+			if kind == segCatchAll && route.AutoArgNames != nil {
+				segs := make([]string, len(route.AutoArgNames))
+				for j, argName := range route.AutoArgNames {
+					val, ok := argValues[argName]
+					if !ok {
+						val = "<nil>"
+						ERROR.Print("revel/router: reverse route missing route arg ", argName)
+					}
+					segs[j] = val
+					consumed = append(consumed, argName)
+				}
+				pathElements[i] = strings.Join(segs, "/")
+				continue
+			}
+
+			val, ok := argValues[name]
 			if !ok {
 				val = "<nil>"
-				ERROR.Print("revel/router: reverse route missing route arg ", el[1:])
+				ERROR.Print("revel/router: reverse route missing route arg ", name)
+			} else if c := constraintFor(typ, constraintSrc); c != nil && !c.MatchString(val) {
+				// This route can't produce a URL honoring its own
+				// constraint; try the next route rather than returning one
+				// that violates it (another route may share this action
+				// name with a looser or different constraint).
+				ERROR.Print("revel/router: reverse route arg ", name, " value ", val, " does not satisfy its constraint, trying next route")
+				continue routes
 			}
 			pathElements[i] = val
-			delete(argValues, el[1:])
+			consumed = append(consumed, name)
 			continue
 		}
+		for _, name := range consumed {
+			delete(argValues, name)
+		}
 
 		// Add any args that were not inserted into the path into the query string.
 		for k, v := range argValues {
@@ -409,7 +1009,8 @@ func (router *Router) Reverse(action string, argValues map[string]string) *Actio
 			Star:   star,
 			Action: action,
 			Args:   argValues,
-			Host:   "TODO",
+			Host:   host,
+			Scheme: route.Scheme,
 		}
 	}
 	ERROR.Println("Failed to find reverse route:", action, argValues)
@@ -435,12 +1036,33 @@ func RouterFilter(c *Controller, fc []Filter) {
 		return
 	}
 
+	// The route may want to redirect to the path's canonical form.
+	if route.Action == "redirect" {
+		c.Result = c.Redirect(route.Path)
+		return
+	}
+
 	// The route may want to explicitly return a 404.
 	if route.Action == "404" {
 		c.Result = c.NotFound("(intentionally)")
 		return
 	}
 
+	// The path matched, but not for this method: reply 405 with the Allow
+	// header listing what does work.
+	if route.Action == "405" {
+		c.Response.Out.Header().Set("Allow", strings.Join(route.AllowedMethods, ", "))
+		c.Response.Out.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// No action handles OPTIONS at this path; answer it automatically.
+	if route.Action == "options" {
+		c.Response.Out.Header().Set("Allow", strings.Join(route.AllowedMethods, ", "))
+		c.Response.Out.WriteHeader(http.StatusOK)
+		return
+	}
+
 	// Set the action.
 	if err := c.SetAction(route.ControllerName, route.MethodName); err != nil {
 		c.Result = c.NotFound(err.Error())
@@ -465,5 +1087,19 @@ func RouterFilter(c *Controller, fc []Filter) {
 		}
 	}
 
+	// Compose any resolved middleware around the action invocation so it can
+	// run auth, CORS, rate-limiting, tracing, etc. without a dedicated Filter.
+	if len(route.Middleware) > 0 {
+		action := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+			fc[0](c, fc[1:])
+		})
+		var handler http.Handler = action
+		for i := len(route.Middleware) - 1; i >= 0; i-- {
+			handler = route.Middleware[i](handler)
+		}
+		handler.ServeHTTP(c.Response.Out, c.Request.Request)
+		return
+	}
+
 	fc[0](c, fc[1:])
 }
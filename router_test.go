@@ -0,0 +1,198 @@
+package revel
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newTestRouter(t *testing.T, routes []*Route) *Router {
+	t.Helper()
+	router := &Router{Routes: routes}
+	if err := router.updateTree(); err != nil {
+		t.Fatalf("updateTree: %v", err)
+	}
+	return router
+}
+
+func TestRouterHostBasedRouting(t *testing.T) {
+	tenantA := NewRoute("GET", "/dashboard", "Dashboard.ShowA", "", nil)
+	tenantA.Host = "a.example.com"
+	tenantB := NewRoute("GET", "/dashboard", "Dashboard.ShowB", "", nil)
+	tenantB.Host = "b.example.com"
+
+	router := newTestRouter(t, []*Route{tenantA, tenantB})
+
+	match := router.Route(httptest.NewRequest("GET", "http://a.example.com/dashboard", nil))
+	if match == nil || match.MethodName != "ShowA" {
+		t.Fatalf("a.example.com routed to %+v, want Dashboard.ShowA", match)
+	}
+
+	match = router.Route(httptest.NewRequest("GET", "http://b.example.com/dashboard", nil))
+	if match == nil || match.MethodName != "ShowB" {
+		t.Fatalf("b.example.com routed to %+v, want Dashboard.ShowB", match)
+	}
+
+	if match := router.Route(httptest.NewRequest("GET", "http://c.example.com/dashboard", nil)); match != nil {
+		t.Fatalf("unrecognized host should not match, got %+v", match)
+	}
+}
+
+// A route constrained to "scheme: https" hit over plain http must redirect
+// to the canonical https URL rather than 404.
+func TestRouterSchemeRedirect(t *testing.T) {
+	secure := NewRoute("GET", "/admin", "Admin.Index", "", nil)
+	secure.Scheme = "https"
+
+	router := newTestRouter(t, []*Route{secure})
+
+	match := router.Route(httptest.NewRequest("GET", "http://example.com/admin", nil))
+	if match == nil || match.Action != "redirect" {
+		t.Fatalf("expected a scheme redirect, got %+v", match)
+	}
+	if want := "https://example.com/admin"; match.Path != want {
+		t.Fatalf("redirect Path = %q, want %q", match.Path, want)
+	}
+
+	// Same route matched directly over https: no redirect, serves normally.
+	httpsReq := httptest.NewRequest("GET", "https://example.com/admin", nil)
+	httpsReq.TLS = &tls.ConnectionState{}
+	match = router.Route(httpsReq)
+	if match == nil || match.Action == "redirect" {
+		t.Fatalf("https request should not redirect, got %+v", match)
+	}
+}
+
+func TestRouterMethodNotAllowedAndOptions(t *testing.T) {
+	get := NewRoute("GET", "/widgets", "Widgets.Index", "", nil)
+	post := NewRoute("POST", "/widgets", "Widgets.Create", "", nil)
+	router := newTestRouter(t, []*Route{get, post})
+
+	match := router.Route(httptest.NewRequest("DELETE", "/widgets", nil))
+	if match == nil || match.Action != "405" {
+		t.Fatalf("expected 405, got %+v", match)
+	}
+	if want := []string{"GET", "HEAD", "POST"}; !sameStrings(match.AllowedMethods, want) {
+		t.Fatalf("AllowedMethods = %v, want %v", match.AllowedMethods, want)
+	}
+
+	match = router.Route(httptest.NewRequest("OPTIONS", "/widgets", nil))
+	if match == nil || match.Action != "options" {
+		t.Fatalf("expected an auto-answered OPTIONS, got %+v", match)
+	}
+	if want := []string{"GET", "HEAD", "POST"}; !sameStrings(match.AllowedMethods, want) {
+		t.Fatalf("AllowedMethods = %v, want %v", match.AllowedMethods, want)
+	}
+}
+
+// Host/scheme-constrained routes must get the same 405/OPTIONS treatment as
+// the path tree, not just fall through to a bare 404.
+func TestRouterVhostMethodNotAllowed(t *testing.T) {
+	get := NewRoute("GET", "/api/widgets", "Widgets.Index", "", nil)
+	get.Host = "api.example.com"
+	router := newTestRouter(t, []*Route{get})
+
+	match := router.Route(httptest.NewRequest("POST", "http://api.example.com/api/widgets", nil))
+	if match == nil || match.Action != "405" {
+		t.Fatalf("expected 405 for vhost route, got %+v", match)
+	}
+	if want := []string{"GET", "HEAD"}; !sameStrings(match.AllowedMethods, want) {
+		t.Fatalf("AllowedMethods = %v, want %v", match.AllowedMethods, want)
+	}
+}
+
+func TestResolveMiddlewareOrdering(t *testing.T) {
+	var calls []string
+	record := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls = append(calls, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+
+	RegisterMiddleware("testGlobal", record("global"))
+	RegisterMiddleware("testYAML", record("yaml"))
+	RegisterMiddleware("testRoute", record("route"))
+	defer func() {
+		delete(middlewareRegistry, "testGlobal")
+		delete(middlewareRegistry, "testYAML")
+		delete(middlewareRegistry, "testRoute")
+	}()
+
+	router := &Router{}
+	router.Use(middlewareRegistry["testGlobal"])
+	router.yamlMiddleware = []Middleware{middlewareRegistry["testYAML"]}
+
+	route := NewRoute("GET", "/x", "X.Y", "", nil)
+	route.MiddlewareNames = []string{"testRoute"}
+
+	chain := router.resolveMiddleware(route)
+	var handler http.Handler = http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+	for i := len(chain) - 1; i >= 0; i-- {
+		handler = chain[i](handler)
+	}
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/x", nil))
+
+	if want := []string{"global", "yaml", "route"}; !sameStrings(calls, want) {
+		t.Fatalf("middleware ran in order %v, want %v", calls, want)
+	}
+}
+
+func TestValidateRouteRejectsUnknownMiddleware(t *testing.T) {
+	route := NewRoute("GET", "/secure", "Secure.Index", "", nil)
+	route.MiddlewareNames = []string{"doesNotExist"}
+	if err := validateRoute(route); err == nil {
+		t.Fatal("expected an error for an unregistered middleware name")
+	}
+}
+
+// A "- group:" entry's path prefix and middleware must reach every route
+// nested under it, on top of that route's own "middleware:" entries, and a
+// top-level "- use:" entry must be collected separately for the caller to
+// register as global middleware.
+func TestParseRoutesGroupAndMiddlewareInheritance(t *testing.T) {
+	content := `
+- use: [Global]
+
+- group: /admin
+  middleware: [Auth]
+  routes:
+    - method: GET
+      path: /dashboard
+      action: Admin.Dashboard
+      middleware: [Logging]
+`
+	routes, use, _, err := parseRoutes("routes.yml", "", content, false)
+	if err != nil {
+		t.Fatalf("parseRoutes: %v", err)
+	}
+	if want := []string{"Global"}; !sameStrings(use, want) {
+		t.Fatalf("global use = %v, want %v", use, want)
+	}
+	if len(routes) != 1 {
+		t.Fatalf("expected 1 route, got %d", len(routes))
+	}
+
+	route := routes[0]
+	if want := "/admin/dashboard"; route.Path != want {
+		t.Fatalf("path = %q, want %q (group prefix applied)", route.Path, want)
+	}
+	if want := []string{"Auth", "Logging"}; !sameStrings(route.MiddlewareNames, want) {
+		t.Fatalf("middleware = %v, want %v (group, then route)", route.MiddlewareNames, want)
+	}
+}
+
+func sameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,380 @@
+package revel
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// This file implements the route tree that backs Router.Tree: a radix tree
+// indexed purely on path segments, with runs of plain text within a segment
+// compressed the way httprouter/chi do. Three kinds of edges hang off each
+// node: static text, a single typed or untyped parameter (":name",
+// "{name}", or "{name:type}"), and a trailing catch-all ("*name"). A
+// constrained parameter that fails to match falls through to the next
+// candidate instead of failing the whole lookup, so e.g. "/user/{id:int}"
+// and "/user/new" can coexist at the same position.
+//
+// A path is shared by every route registered for it regardless of method:
+// the leaf at the end of it holds one Route per HTTP method (plus a "*"
+// entry for a method-agnostic route), so Router.Route can tell a 404 (no
+// leaf at all) apart from a 405 (a leaf, but not for this method).
+
+type pathSegmentKind byte
+
+const (
+	segStatic pathSegmentKind = iota
+	segParam
+	segCatchAll
+)
+
+var intArgPattern = regexp.MustCompile(`^-?\d+$`)
+
+// parsePathSegment classifies a single "/"-delimited route path segment as a
+// literal, a ":name" or "{name[:type[(constraint)]]}" parameter, or a
+// "*name" catch-all, returning the parameter/catch-all name and, for a
+// typed "{...}" parameter, its type and any regex constraint source.
+func parsePathSegment(seg string) (kind pathSegmentKind, name, typ, constraintSrc string) {
+	switch {
+	case seg == "":
+		return segStatic, "", "", ""
+	case seg[0] == '*':
+		return segCatchAll, seg[1:], "", ""
+	case seg[0] == ':':
+		return segParam, seg[1:], "", ""
+	case seg[0] == '{' && strings.HasSuffix(seg, "}"):
+		inner := seg[1 : len(seg)-1]
+		colon := strings.IndexByte(inner, ':')
+		if colon < 0 {
+			return segParam, inner, "", ""
+		}
+		name, rest := inner[:colon], inner[colon+1:]
+		if paren := strings.IndexByte(rest, '('); paren >= 0 && strings.HasSuffix(rest, ")") {
+			return segParam, name, rest[:paren], rest[paren+1 : len(rest)-1]
+		}
+		return segParam, name, rest, ""
+	}
+	return segStatic, "", "", ""
+}
+
+// constraintFor builds the regexp enforcing a typed parameter's value, or
+// nil for an unconstrained ("", "string") parameter.
+func constraintFor(typ, constraintSrc string) *regexp.Regexp {
+	switch typ {
+	case "", "string":
+		return nil
+	case "int":
+		return intArgPattern
+	case "regex":
+		re, err := regexp.Compile(constraintSrc)
+		if err != nil {
+			ERROR.Println("revel/router: invalid regex constraint", constraintSrc, ":", err)
+			return nil
+		}
+		return re
+	default:
+		WARN.Println("revel/router: unknown parameter type", typ, "- treating as unconstrained")
+		return nil
+	}
+}
+
+// routeNode is one edge of the route tree: either a run of static text, a
+// ":name"/"{name[:type]}" parameter, or a "*name" catch-all.
+type routeNode struct {
+	prefix   string
+	children []*routeNode
+
+	param    *routeNode
+	paramArg arg // name + constraint for the param edge, when param != nil
+
+	catchAll    *routeNode
+	catchAllArg arg
+
+	leaf *routeLeaf
+}
+
+// routeLeaf is attached to the node a route's full path resolves to. It
+// holds every route registered for that path, keyed by method, since two
+// routes sharing a path (e.g. "GET /app/:id" and "POST /app/:id") share the
+// same node and the same captured args.
+type routeLeaf struct {
+	args     []arg             // path params captured en route to this leaf, in match order
+	byMethod map[string]*Route // keyed by uppercase HTTP method, or "*" for a method-agnostic route
+}
+
+// addRoute registers route on this leaf, failing if another route is
+// already registered for the same method here.
+func (leaf *routeLeaf) addRoute(route *Route) error {
+	if leaf.byMethod == nil {
+		leaf.byMethod = make(map[string]*Route)
+	}
+	if _, exists := leaf.byMethod[route.Method]; exists {
+		return fmt.Errorf("duplicate route for %s %s", route.Method, route.Path)
+	}
+	leaf.byMethod[route.Method] = route
+	return nil
+}
+
+// resolve returns the route that should handle method at this leaf, honoring
+// the implicit "GET also serves HEAD" convention and a method-agnostic ("*")
+// route registered here.
+func (leaf *routeLeaf) resolve(method string) (*Route, bool) {
+	if route, ok := leaf.byMethod[method]; ok {
+		return route, true
+	}
+	if method == "HEAD" {
+		if route, ok := leaf.byMethod["GET"]; ok {
+			return route, true
+		}
+	}
+	if route, ok := leaf.byMethod["*"]; ok {
+		return route, true
+	}
+	return nil, false
+}
+
+var standardHTTPMethods = []string{"GET", "HEAD", "POST", "PUT", "DELETE", "PATCH", "OPTIONS"}
+
+// allowedMethods lists, in sorted order, the HTTP methods this leaf's routes
+// accept -- for the Allow header of a 405 response or an auto-generated
+// OPTIONS response. A route registered for "*" allows every standard method.
+func (leaf *routeLeaf) allowedMethods() []string {
+	if _, ok := leaf.byMethod["*"]; ok {
+		methods := append([]string{}, standardHTTPMethods...)
+		sort.Strings(methods)
+		return methods
+	}
+	_, hasHead := leaf.byMethod["HEAD"]
+	_, hasGet := leaf.byMethod["GET"]
+	methods := make([]string, 0, len(leaf.byMethod)+1)
+	for method := range leaf.byMethod {
+		methods = append(methods, method)
+	}
+	if hasGet && !hasHead {
+		methods = append(methods, "HEAD")
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+func newRouteTree() *routeNode {
+	return &routeNode{}
+}
+
+// newRouteLeaf builds a routeLeaf directly from a set of routes that have
+// already been matched by some means other than the path tree (namely
+// Router.routeVhost, which matches Host/Scheme-constrained routes via their
+// own regexps). It exists so that code path can resolve method/405/OPTIONS
+// through the same routeLeaf machinery as the tree-backed one, rather than
+// duplicating it. The first route registered for a given method wins; later
+// duplicates are dropped (mirroring routeNode.add's duplicate rejection,
+// minus the error since there's no Refresh-time validation pass for vhost
+// routes to surface it through).
+func newRouteLeaf(routes ...*Route) *routeLeaf {
+	leaf := &routeLeaf{}
+	for _, route := range routes {
+		_ = leaf.addRoute(route)
+	}
+	return leaf
+}
+
+// Add inserts route into the tree at route.Path, returning an error if it
+// conflicts with an existing route (a duplicate method at the same path, or
+// a parameter/catch-all whose name disagrees with one already registered at
+// the same position).
+func (n *routeNode) Add(route *Route) error {
+	return n.add(route.Path, route, nil)
+}
+
+func (n *routeNode) add(path string, route *Route, args []arg) error {
+	if path == "" {
+		if n.leaf == nil {
+			n.leaf = &routeLeaf{}
+		}
+		n.leaf.args = args
+		return n.leaf.addRoute(route)
+	}
+
+	switch path[0] {
+	case ':':
+		seg, rest := splitSegment(path)
+		_, name, _, _ := parsePathSegment(seg)
+		return n.addParam(name, "", "", rest, route, args)
+
+	case '{':
+		seg, rest := splitSegment(path)
+		kind, name, typ, constraintSrc := parsePathSegment(seg)
+		if kind != segParam {
+			return fmt.Errorf("invalid route segment %q in %s", seg, route.Path)
+		}
+		return n.addParam(name, typ, constraintSrc, rest, route, args)
+
+	case '*':
+		name := path[1:]
+		if n.catchAll == nil {
+			n.catchAll = &routeNode{}
+			n.catchAllArg = arg{name: name, index: len(args)}
+		} else if n.catchAllArg.name != name {
+			return fmt.Errorf("conflicting catch-all names %q and %q for %s", n.catchAllArg.name, name, route.Path)
+		}
+		return n.catchAll.add("", route, append(args, arg{name: name, index: len(args)}))
+
+	default:
+		end := nextSegmentMarker(path)
+		static, rest := path, ""
+		if end >= 0 {
+			static, rest = path[:end], path[end:]
+		}
+		return n.insertStatic(static).add(rest, route, args)
+	}
+}
+
+// nextSegmentMarker finds the next ':', '{', or '*' in path that starts a
+// new segment -- i.e. immediately follows a "/" -- and returns its index, or
+// -1 if path has no such marker. A marker character appearing elsewhere
+// (e.g. the ":beta" in "/docs/v1:beta") is literal text, not a parameter.
+func nextSegmentMarker(path string) int {
+	for i := 1; i < len(path); i++ {
+		if path[i-1] != '/' {
+			continue
+		}
+		switch path[i] {
+		case ':', '{', '*':
+			return i
+		}
+	}
+	return -1
+}
+
+// splitSegment peels the first "/"-delimited segment (a parameter or
+// catch-all spec) off of path, returning it along with the remainder
+// (including the leading "/", if any).
+func splitSegment(path string) (seg, rest string) {
+	if end := strings.IndexByte(path, '/'); end >= 0 {
+		return path[:end], path[end:]
+	}
+	return path, ""
+}
+
+func (n *routeNode) addParam(name, typ, constraintSrc, rest string, route *Route, args []arg) error {
+	c := constraintFor(typ, constraintSrc)
+	if n.param == nil {
+		n.param = &routeNode{}
+		n.paramArg = arg{name: name, constraint: c}
+	} else if n.paramArg.name != name {
+		return fmt.Errorf("conflicting parameter names %q and %q at the same position for %s", n.paramArg.name, name, route.Path)
+	}
+	return n.param.add(rest, route, append(args, arg{name: name, index: len(args), constraint: c}))
+}
+
+// insertStatic finds or creates the child of n whose prefix represents
+// text, splitting an existing child if only part of its prefix matches.
+func (n *routeNode) insertStatic(text string) *routeNode {
+	if text == "" {
+		return n
+	}
+	for _, child := range n.children {
+		cp := commonPrefixLen(child.prefix, text)
+		if cp == 0 {
+			continue
+		}
+		if cp < len(child.prefix) {
+			child.split(cp)
+		}
+		if cp == len(text) {
+			return child
+		}
+		return child.insertStatic(text[cp:])
+	}
+	child := &routeNode{prefix: text}
+	n.children = append(n.children, child)
+	return child
+}
+
+// split breaks n's prefix at byte offset at, demoting everything past that
+// point (children, param/catch-all edges, leaf) onto a new child node.
+func (n *routeNode) split(at int) {
+	tail := &routeNode{
+		prefix:      n.prefix[at:],
+		children:    n.children,
+		param:       n.param,
+		paramArg:    n.paramArg,
+		catchAll:    n.catchAll,
+		catchAllArg: n.catchAllArg,
+		leaf:        n.leaf,
+	}
+	n.prefix = n.prefix[:at]
+	n.children = []*routeNode{tail}
+	n.param, n.catchAll, n.leaf = nil, nil, nil
+	n.paramArg, n.catchAllArg = arg{}, arg{}
+}
+
+func commonPrefixLen(a, b string) int {
+	max := len(a)
+	if len(b) < max {
+		max = len(b)
+	}
+	i := 0
+	for i < max && a[i] == b[i] {
+		i++
+	}
+	return i
+}
+
+// Find looks up path in the tree, returning the leaf holding every route
+// registered for it (across all methods) along with the captured params, or
+// (nil, nil) if no route claims the path at all. The caller resolves the
+// method-specific route via routeLeaf.resolve. A typed parameter whose
+// constraint rejects a segment is not a dead end: matching falls through to
+// the next candidate at that position.
+func (n *routeNode) Find(path string) (*routeLeaf, url.Values) {
+	leaf, values := n.find(path)
+	if leaf == nil {
+		return nil, nil
+	}
+	if len(values) == 0 {
+		return leaf, nil
+	}
+	params := make(url.Values, len(values))
+	for i, v := range values {
+		params[leaf.args[i].name] = []string{v}
+	}
+	return leaf, params
+}
+
+func (n *routeNode) find(path string) (*routeLeaf, []string) {
+	if path == "" {
+		if n.leaf != nil {
+			return n.leaf, nil
+		}
+		if n.catchAll != nil && n.catchAll.leaf != nil {
+			return n.catchAll.leaf, []string{""}
+		}
+		return nil, nil
+	}
+
+	for _, child := range n.children {
+		if strings.HasPrefix(path, child.prefix) {
+			if leaf, values := child.find(path[len(child.prefix):]); leaf != nil {
+				return leaf, values
+			}
+		}
+	}
+
+	if n.param != nil {
+		seg, rest := splitSegment(path)
+		if seg != "" && (n.paramArg.constraint == nil || n.paramArg.constraint.MatchString(seg)) {
+			if leaf, values := n.param.find(rest); leaf != nil {
+				return leaf, append([]string{seg}, values...)
+			}
+		}
+	}
+
+	if n.catchAll != nil && n.catchAll.leaf != nil {
+		return n.catchAll.leaf, []string{path}
+	}
+
+	return nil, nil
+}
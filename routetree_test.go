@@ -0,0 +1,89 @@
+package revel
+
+import "testing"
+
+func mustAddRoute(t *testing.T, tree *routeNode, method, path, action string) *Route {
+	t.Helper()
+	route := NewRoute(method, path, action, "", nil)
+	if err := tree.Add(route); err != nil {
+		t.Fatalf("Add(%s %s): %v", method, path, err)
+	}
+	return route
+}
+
+// A ':', '{', or '*' that doesn't immediately follow a "/" is literal text,
+// not a parameter marker -- regression test for a parser that used to scan
+// for those characters anywhere in the remaining path.
+func TestRouteTreeStaticSegmentWithSpecialChars(t *testing.T) {
+	tree := newRouteTree()
+	literal := mustAddRoute(t, tree, "GET", "/docs/v1:beta", "Docs.Beta")
+
+	leaf, params := tree.Find("/docs/v1:beta")
+	if leaf == nil {
+		t.Fatal("expected a match for the literal path")
+	}
+	if route, ok := leaf.resolve("GET"); !ok || route != literal {
+		t.Fatalf("resolve(GET) = %+v, %v; want the literal route", route, ok)
+	}
+	if len(params) != 0 {
+		t.Fatalf("literal path should capture no params, got %v", params)
+	}
+}
+
+func TestRouteTreeTypedParamFallsThroughToStatic(t *testing.T) {
+	tree := newRouteTree()
+	typed := mustAddRoute(t, tree, "GET", "/user/{id:int}", "User.Show")
+	static := mustAddRoute(t, tree, "GET", "/user/new", "User.New")
+
+	leaf, params := tree.Find("/user/42")
+	if leaf == nil {
+		t.Fatal("expected a match for /user/42")
+	}
+	if route, ok := leaf.resolve("GET"); !ok || route != typed {
+		t.Fatalf("resolve(GET) = %+v, %v; want the int-constrained route", route, ok)
+	}
+	if got := params.Get("id"); got != "42" {
+		t.Fatalf("id param = %q, want 42", got)
+	}
+
+	leaf, params = tree.Find("/user/new")
+	if leaf == nil {
+		t.Fatal("expected a match for /user/new")
+	}
+	if route, ok := leaf.resolve("GET"); !ok || route != static {
+		t.Fatalf("resolve(GET) = %+v, %v; want the static route, not the int-constrained one", route, ok)
+	}
+	if len(params) != 0 {
+		t.Fatalf("static path should capture no params, got %v", params)
+	}
+
+	if leaf, _ := tree.Find("/user/abc"); leaf != nil {
+		t.Fatalf("expected no match for /user/abc: fails the int constraint and isn't /user/new")
+	}
+}
+
+func TestRouteLeafResolveAndAllowedMethods(t *testing.T) {
+	leaf := &routeLeaf{}
+	get := NewRoute("GET", "/app/:id", "App.Show", "", nil)
+	post := NewRoute("POST", "/app/:id", "App.Create", "", nil)
+	if err := leaf.addRoute(get); err != nil {
+		t.Fatal(err)
+	}
+	if err := leaf.addRoute(post); err != nil {
+		t.Fatal(err)
+	}
+
+	if route, ok := leaf.resolve("GET"); !ok || route != get {
+		t.Fatalf("resolve(GET) = %+v, %v; want the GET route", route, ok)
+	}
+	if route, ok := leaf.resolve("HEAD"); !ok || route != get {
+		t.Fatalf("resolve(HEAD) = %+v, %v; want it to fall back to the GET route", route, ok)
+	}
+	if _, ok := leaf.resolve("DELETE"); ok {
+		t.Fatal("resolve(DELETE) should fail: no route registered for it")
+	}
+
+	if got, want := leaf.allowedMethods(), []string{"GET", "HEAD", "POST"}; !sameStrings(got, want) {
+		t.Fatalf("allowedMethods() = %v, want %v", got, want)
+	}
+}